@@ -0,0 +1,211 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+type folderResult struct {
+	FolderID string      `json:"folderID"`
+	Path     string      `json:"path"`
+	Included []itemEntry `json:"included"`
+	Ignored  []itemEntry `json:"ignored"`
+	Errors   []scanError `json:"errors"`
+}
+
+type batchOptions struct {
+	mode          includeMode
+	trace         bool
+	jsonOutput    bool
+	noIgnoreCache bool
+	parallel      int
+}
+
+// runAllFolders scans every folder in cfg (optionally restricted to
+// folderIDs) using its own fs.Filesystem and .stignore, turning the tool
+// into a whole-instance dry-run auditor rather than a single-directory
+// helper. Folders are scanned with up to opts.parallel workers.
+func runAllFolders(ctx context.Context, cfg config.Configuration, folderIDs []string, opts batchOptions, w io.Writer) ([]folderResult, error) {
+	folders := selectFolders(cfg, folderIDs)
+
+	parallel := opts.parallel
+	if parallel < 1 {
+		parallel = 1
+	}
+
+	results := make([]folderResult, len(folders))
+	sem := make(chan struct{}, parallel)
+	var wg sync.WaitGroup
+
+	for i, folder := range folders {
+		i, folder := i, folder
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			results[i] = scanFolder(ctx, cfg, folder, opts, w)
+		}()
+	}
+	wg.Wait()
+
+	emitBatchResults(w, results, opts.jsonOutput)
+	return results, nil
+}
+
+// scanFolder never returns an error: a folder that can't be scanned (e.g. a
+// configured path that no longer exists on disk) is common in a whole-instance
+// audit, so it's recorded as a scanError against that folder's result and the
+// batch continues, rather than aborting and discarding every other folder's
+// output.
+func scanFolder(ctx context.Context, cfg config.Configuration, folder config.FolderConfiguration, opts batchOptions, w io.Writer) folderResult {
+	rc := buildRunConfigFromFolder(cfg, folder, folder.Path, opts.mode, opts.trace, opts.jsonOutput, opts.noIgnoreCache)
+	rc.folderID = folder.ID
+	rc.filesystemType = folder.FilesystemType
+	rc.caseSensitiveFS = folder.CaseSensitiveFS
+	rc.junctionsAsDirs = folder.JunctionsAsDirs
+	rc.folderType = folder.Type
+
+	ffs := runCfgFilesystem(folder, rc)
+
+	var traceOut io.Writer = io.Discard
+	if opts.trace {
+		// Multiple folders trace concurrently onto the shared w; syncWriter
+		// keeps each encoded event (JSON or text) from interleaving with
+		// another folder's, and the outputter's folderID tags which folder
+		// an event belongs to instead of corrupting the stream with a
+		// hand-rolled text prefix.
+		traceOut = &syncWriter{w: w}
+	}
+	out := newOutputter(traceOut, opts.trace, opts.jsonOutput)
+	out.folderID = folder.ID
+
+	if rc.folderType == config.FolderTypeReceiveEncrypted {
+		included, scanErrs, err := listEncryptedBlobs(ctx, ffs)
+		if err != nil {
+			scanErrs = append(scanErrs, newScanError("walk", folder.Path, err, false))
+		}
+		return folderResult{
+			FolderID: folder.ID,
+			Path:     folder.Path,
+			Included: included,
+			Errors:   scanErrs,
+		}
+	}
+
+	matcher := newIgnoreMatcher(ffs, rc.ignoreCache)
+
+	var scanErrs []scanError
+	if err := matcher.Load(".stignore"); err != nil && !fs.IsNotExist(err) {
+		scanErrs = append(scanErrs, newScanError("stignore", ".stignore", err, true))
+	}
+
+	included, ignored, walkErrs, err := walkTrace(ctx, ffs, matcher, rc, out)
+	scanErrs = append(scanErrs, walkErrs...)
+	if err != nil {
+		scanErrs = append(scanErrs, newScanError("walk", folder.Path, err, false))
+	}
+
+	return folderResult{
+		FolderID: folder.ID,
+		Path:     folder.Path,
+		Included: included,
+		Ignored:  ignored,
+		Errors:   scanErrs,
+	}
+}
+
+// syncWriter serializes concurrent writes onto w: folders are scanned with
+// up to opts.parallel goroutines, and without this a -trace run would
+// interleave partial writes from different folders onto the shared writer,
+// corrupting both the JSON and text trace output.
+type syncWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func (s *syncWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(b)
+}
+
+func selectFolders(cfg config.Configuration, folderIDs []string) []config.FolderConfiguration {
+	if len(folderIDs) == 0 {
+		return cfg.Folders
+	}
+	want := make(map[string]bool, len(folderIDs))
+	for _, id := range folderIDs {
+		want[id] = true
+	}
+	var folders []config.FolderConfiguration
+	for _, folder := range cfg.Folders {
+		if want[folder.ID] {
+			folders = append(folders, folder)
+		}
+	}
+	return folders
+}
+
+func emitBatchResults(w io.Writer, results []folderResult, jsonOutput bool) {
+	sorted := make([]folderResult, len(results))
+	copy(sorted, results)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].FolderID < sorted[j].FolderID })
+
+	var totalIncluded, totalIgnored, totalErrors int
+	enc := json.NewEncoder(w)
+	for _, res := range sorted {
+		totalIncluded += len(res.Included)
+		totalIgnored += len(res.Ignored)
+		totalErrors += len(res.Errors)
+		if jsonOutput {
+			_ = enc.Encode(res)
+			continue
+		}
+		fmt.Fprintf(w, "== folder %s (%s) ==\n", res.FolderID, res.Path)
+		printSummary(w, res.Included, res.Ignored)
+		if len(res.Errors) > 0 {
+			fmt.Fprintln(w)
+			printErrorsSummary(w, res.Errors)
+		}
+		fmt.Fprintln(w)
+	}
+
+	if jsonOutput {
+		_ = enc.Encode(map[string]interface{}{
+			"event":         "aggregate",
+			"folders":       len(sorted),
+			"totalIncluded": totalIncluded,
+			"totalIgnored":  totalIgnored,
+			"totalErrors":   totalErrors,
+		})
+		return
+	}
+	fmt.Fprintf(w, "Aggregate: %d folders, %d included, %d ignored, %d errors\n", len(sorted), totalIncluded, totalIgnored, totalErrors)
+}
+
+func shouldFailBatch(failOn failOnMode, results []folderResult) bool {
+	switch failOn {
+	case failOnErrors:
+		for _, res := range results {
+			if len(res.Errors) > 0 {
+				return true
+			}
+		}
+	case failOnAnyIgnored:
+		for _, res := range results {
+			if len(res.Errors) > 0 || len(res.Ignored) > 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
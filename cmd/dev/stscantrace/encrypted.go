@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+// listEncryptedBlobs previews the raw on-disk layout of a receive-encrypted
+// folder. Syncthing derives the plaintext name (and therefore which
+// .stignore patterns would apply) from a per-folder key that lives in the
+// unexported lib/model package, so there is no plaintext-side matcher this
+// tool can run the ciphertext blob names through. Every regular file is
+// reported as an included opaque blob and no ignore matching is attempted.
+func listEncryptedBlobs(ctx context.Context, ffs fs.Filesystem) ([]itemEntry, []scanError, error) {
+	var included []itemEntry
+	var scanErrs []scanError
+
+	walkFn := func(path string, info fs.FileInfo, err error) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if path == "" {
+			return nil
+		}
+		if err != nil {
+			scanErrs = append(scanErrs, newScanError("walk", path, err, true))
+			return nil
+		}
+		if fs.IsInternal(path) || info.IsDir() {
+			return nil
+		}
+
+		kind := "blob"
+		if info.IsSymlink() {
+			kind = "symlink"
+		}
+		included = append(included, itemEntry{Path: path, Kind: kind})
+		return nil
+	}
+
+	if err := ffs.Walk(".", walkFn); err != nil {
+		return included, scanErrs, err
+	}
+	return included, scanErrs, nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+	"github.com/syncthing/syncthing/lib/scanner"
+)
+
+// emitFileInfos walks the already-classified included entries and, for each
+// one, produces a protocol.FileInfo the way Syncthing's own scanner would --
+// including block hashes for regular files -- so the stream can be diffed
+// against a real instance's /rest/db/browse output to debug why a file or
+// version differs on a peer.
+func emitFileInfos(ctx context.Context, ffs fs.Filesystem, included []itemEntry, rc runConfig, w io.Writer, hashers int) error {
+	if hashers < 1 {
+		hashers = 1
+	}
+
+	type job struct {
+		idx   int
+		entry itemEntry
+	}
+	type result struct {
+		idx  int
+		info protocol.FileInfo
+		err  error
+	}
+
+	jobs := make(chan job)
+	results := make(chan result, len(included))
+
+	var wg sync.WaitGroup
+	for i := 0; i < hashers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				info, err := buildFileInfo(ctx, ffs, j.entry, rc)
+				results <- result{idx: j.idx, info: info, err: err}
+			}
+		}()
+	}
+
+	go func() {
+		defer close(jobs)
+		for i, entry := range included {
+			select {
+			case jobs <- job{idx: i, entry: entry}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+
+	ordered := make([]*protocol.FileInfo, len(included))
+	var firstErr error
+	for res := range results {
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			continue
+		}
+		fi := res.info
+		ordered[res.idx] = &fi
+	}
+	if firstErr != nil {
+		return firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	for _, fi := range ordered {
+		if fi == nil {
+			continue
+		}
+		if err := enc.Encode(fi); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func buildFileInfo(ctx context.Context, ffs fs.Filesystem, entry itemEntry, rc runConfig) (protocol.FileInfo, error) {
+	info, err := ffs.Lstat(entry.Path)
+	if err != nil {
+		return protocol.FileInfo{}, fmt.Errorf("stat %s: %w", entry.Path, err)
+	}
+
+	fi := protocol.FileInfo{
+		Name:       entry.Path,
+		ModifiedS:  info.ModTime().Unix(),
+		ModifiedNs: int32(info.ModTime().Nanosecond()),
+	}
+	if rc.ignorePerms {
+		fi.NoPermissions = true
+	} else {
+		fi.Permissions = uint32(info.Mode()) & 0o7777
+	}
+
+	switch {
+	case info.IsSymlink():
+		target, err := ffs.ReadSymlink(entry.Path)
+		if err != nil {
+			return protocol.FileInfo{}, fmt.Errorf("readlink %s: %w", entry.Path, err)
+		}
+		fi.Type = protocol.FileInfoTypeSymlink
+		fi.SymlinkTarget = target
+
+	case info.IsDir():
+		fi.Type = protocol.FileInfoTypeDirectory
+
+	default:
+		fi.Type = protocol.FileInfoTypeFile
+		fi.Size = info.Size()
+		useWeakHash := rc.weakHashPct > 0
+		blocks, err := scanner.HashFile(ctx, ffs, entry.Path, rc.blockSize, nil, useWeakHash)
+		if err != nil {
+			return protocol.FileInfo{}, fmt.Errorf("hash %s: %w", entry.Path, err)
+		}
+		fi.Blocks = blocks
+	}
+
+	if rc.scanOwnership || rc.scanXattrs {
+		fi.Platform = buildPlatformData(ffs, entry.Path, info, rc)
+	}
+
+	return fi, nil
+}
+
+func buildPlatformData(ffs fs.Filesystem, path string, info fs.FileInfo, rc runConfig) protocol.PlatformData {
+	var platform protocol.PlatformData
+	if rc.scanOwnership {
+		platform.Unix = ownershipUnixData(info)
+	}
+	if rc.scanXattrs {
+		if xattrs, err := ffs.GetXattr(path, rc.xattrFilter); err == nil && len(xattrs) > 0 {
+			platform.Xattrs = xattrs
+		}
+	}
+	return platform
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/config"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+// TestEmitFileInfosOrdering checks that emitFileInfos writes one FileInfo per
+// included entry in the original order, even though the hashing itself fans
+// out across multiple worker goroutines.
+func TestEmitFileInfosOrdering(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{"a.txt", "b.txt", "c.txt", "d.txt"}
+	var included []itemEntry
+	for i, name := range names {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, bytes.Repeat([]byte{byte('a' + i)}, 16), 0o644); err != nil {
+			t.Fatalf("WriteFile(%s): %v", name, err)
+		}
+		included = append(included, itemEntry{Path: name, Kind: "file"})
+	}
+
+	ffs, err := (config.FolderConfiguration{FilesystemType: config.FilesystemTypeBasic, Path: dir}).Filesystem()
+	if err != nil {
+		t.Fatalf("Filesystem(): %v", err)
+	}
+
+	rc := runConfig{blockSize: 128 * 1024}
+	var buf bytes.Buffer
+	if err := emitFileInfos(context.Background(), ffs, included, rc, &buf, 4); err != nil {
+		t.Fatalf("emitFileInfos: %v", err)
+	}
+
+	dec := json.NewDecoder(&buf)
+	for _, name := range names {
+		var fi protocol.FileInfo
+		if err := dec.Decode(&fi); err != nil {
+			t.Fatalf("decode FileInfo for %s: %v", name, err)
+		}
+		if fi.Name != name {
+			t.Errorf("got FileInfo.Name %q, want %q (output order doesn't match input order)", fi.Name, name)
+		}
+	}
+}
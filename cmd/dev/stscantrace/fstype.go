@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+// resolveFilesystemFlags validates -fs-type, returning zero values when
+// -fs-type was not given. config.FilesystemTypeBasic is itself the zero
+// FilesystemType, so the result alone does not tell "not overridden" from
+// "explicitly basic"; callers check whether the flag string was empty.
+func resolveFilesystemFlags(fsTypeStr string) (config.FilesystemType, config.FolderType, error) {
+	if fsTypeStr == "" {
+		return 0, 0, nil
+	}
+
+	var fsType config.FilesystemType
+	var folderType config.FolderType
+	switch fsTypeStr {
+	case "basic":
+		fsType = config.FilesystemTypeBasic
+	case "fake":
+		fsType = config.FilesystemTypeFake
+	case "encrypted":
+		fsType = config.FilesystemTypeBasic
+		folderType = config.FolderTypeReceiveEncrypted
+	default:
+		return 0, 0, fmt.Errorf("invalid -fs-type: %s", fsTypeStr)
+	}
+
+	return fsType, folderType, nil
+}
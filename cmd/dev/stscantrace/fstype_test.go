@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/syncthing/syncthing/lib/config"
+)
+
+func TestResolveFilesystemFlags(t *testing.T) {
+	cases := []struct {
+		fsTypeStr   string
+		wantFsType  config.FilesystemType
+		wantFldType config.FolderType
+		wantErr     bool
+	}{
+		{fsTypeStr: "", wantFsType: 0, wantFldType: 0},
+		{fsTypeStr: "basic", wantFsType: config.FilesystemTypeBasic},
+		{fsTypeStr: "fake", wantFsType: config.FilesystemTypeFake},
+		{fsTypeStr: "encrypted", wantFsType: config.FilesystemTypeBasic, wantFldType: config.FolderTypeReceiveEncrypted},
+		{fsTypeStr: "bogus", wantErr: true},
+	}
+	for _, c := range cases {
+		fsType, folderType, err := resolveFilesystemFlags(c.fsTypeStr)
+		if c.wantErr {
+			if err == nil {
+				t.Errorf("resolveFilesystemFlags(%q): want error, got nil", c.fsTypeStr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("resolveFilesystemFlags(%q): unexpected error: %v", c.fsTypeStr, err)
+			continue
+		}
+		if fsType != c.wantFsType || folderType != c.wantFldType {
+			t.Errorf("resolveFilesystemFlags(%q) = (%v, %v), want (%v, %v)", c.fsTypeStr, fsType, folderType, c.wantFsType, c.wantFldType)
+		}
+	}
+}
+
+// TestListEncryptedBlobsUsesFakefs exercises the receive-encrypted preview
+// path against a fakefs-backed filesystem, so it's reproducible without
+// touching the real disk.
+func TestListEncryptedBlobsUsesFakefs(t *testing.T) {
+	ffs, err := (config.FolderConfiguration{
+		FilesystemType: config.FilesystemTypeFake,
+		Path:           "chunk0-5-test?files=10&maxsize=1000",
+	}).Filesystem()
+	if err != nil {
+		t.Fatalf("Filesystem(): %v", err)
+	}
+
+	included, scanErrs, err := listEncryptedBlobs(context.Background(), ffs)
+	if err != nil {
+		t.Fatalf("listEncryptedBlobs: %v", err)
+	}
+	if len(scanErrs) != 0 {
+		t.Fatalf("listEncryptedBlobs: unexpected scanErrs: %v", scanErrs)
+	}
+	if len(included) == 0 {
+		t.Fatal("listEncryptedBlobs: want at least one blob from the generated fake filesystem, got none")
+	}
+	for _, it := range included {
+		if it.Kind != "blob" && it.Kind != "symlink" {
+			t.Errorf("entry %q: unexpected kind %q", it.Path, it.Kind)
+		}
+	}
+}
+
+func TestIsSymlinkLoop(t *testing.T) {
+	if isSymlinkLoop(nil) {
+		t.Error("isSymlinkLoop(nil) = true, want false")
+	}
+	if !isSymlinkLoop(&linkLoopError{Path: "a/b"}) {
+		t.Error("isSymlinkLoop(&linkLoopError{...}) = false, want true")
+	}
+	if categorizeError("lstat", &linkLoopError{Path: "a/b"}) != categorySymlinkLoop {
+		t.Error("categorizeError with a linkLoopError should report categorySymlinkLoop")
+	}
+}
@@ -8,8 +8,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 	"unicode/utf8"
 
@@ -37,6 +39,18 @@ const (
 	includeAll   includeMode = "all"
 )
 
+// stringList implements flag.Value to support a repeatable -folder-id flag.
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
 type traceEvent struct {
 	Event         string `json:"event"`
 	Path          string `json:"path,omitempty"`
@@ -59,10 +73,11 @@ type itemEntry struct {
 }
 
 type outputter struct {
-	trace   bool
-	json    bool
-	writer  io.Writer
-	encoder *json.Encoder
+	trace    bool
+	json     bool
+	writer   io.Writer
+	encoder  *json.Encoder
+	folderID string
 }
 
 func newOutputter(w io.Writer, trace, jsonOut bool) *outputter {
@@ -82,6 +97,9 @@ func (o *outputter) emit(event traceEvent) {
 	if !o.trace {
 		return
 	}
+	if event.FolderID == "" {
+		event.FolderID = o.folderID
+	}
 	if o.json {
 		_ = o.encoder.Encode(event)
 		return
@@ -89,20 +107,32 @@ func (o *outputter) emit(event traceEvent) {
 	fmt.Fprintln(o.writer, formatTrace(event))
 }
 
-func (o *outputter) emitSummary(included, ignored []itemEntry) {
+func (o *outputter) emitSummary(included, ignored []itemEntry, errs []scanError) {
 	if o.json {
-		_ = o.encoder.Encode(map[string]interface{}{
+		msg := map[string]interface{}{
 			"event":    "summary",
 			"included": included,
 			"ignored":  ignored,
-		})
+			"errors":   errs,
+		}
+		if o.folderID != "" {
+			msg["folderID"] = o.folderID
+		}
+		_ = o.encoder.Encode(msg)
 		return
 	}
 	printSummary(o.writer, included, ignored)
+	if len(errs) > 0 {
+		fmt.Fprintln(o.writer)
+		printErrorsSummary(o.writer, errs)
+	}
 }
 
 func formatTrace(e traceEvent) string {
 	base := "TRACE"
+	if e.FolderID != "" {
+		base = "TRACE[" + e.FolderID + "]"
+	}
 	switch e.Event {
 	case "enter":
 		if e.Normalized != "" && e.Normalized != e.Path {
@@ -177,6 +207,8 @@ type runConfig struct {
 	scanOwnership    bool
 	scanXattrs       bool
 	xattrFilter      config.XattrFilter
+	blockSize        int
+	weakHashPct      int
 	caseSensitiveFS  bool
 	junctionsAsDirs  bool
 	filesystemType   config.FilesystemType
@@ -184,41 +216,75 @@ type runConfig struct {
 	configFilePath   string
 	adHocConfig      bool
 	normalizedLookup map[string]string
+	watchMatcher     *ignore.Matcher
+	folderType       config.FolderType
+	fsURI            string
 }
 
 func main() {
 	var (
 		cfgPath       string
-		folderID      string
+		folderIDs     stringList
 		include       string
 		trace         bool
 		jsonOut       bool
 		noIgnoreCache bool
+		watch         bool
+		resummarizeN  int
+		emit          string
+		hashers       int
+		failOnStr     string
+		allFolders    bool
+		parallel      int
+		fsTypeStr     string
+		fsURI         string
+		snapshotPath  string
+		diffAgainst   string
 	)
 
 	flag.StringVar(&cfgPath, "config", "", "path to config.xml (optional)")
-	flag.StringVar(&folderID, "folder-id", "", "folder ID to use when multiple folders match the same path")
+	flag.Var(&folderIDs, "folder-id", "folder ID to use when multiple folders match the same path; repeatable with -all-folders to restrict the batch")
 	flag.StringVar(&include, "include", string(includeFiles), "include list mode: files|all")
 	flag.BoolVar(&trace, "trace", false, "emit traversal trace")
 	flag.BoolVar(&jsonOut, "json", false, "emit JSON lines")
 	flag.BoolVar(&noIgnoreCache, "no-ignore-cache", false, "disable ignore matcher cache")
+	flag.BoolVar(&watch, "watch", false, "after the initial scan, keep watching the folder and stream change events")
+	flag.IntVar(&resummarizeN, "resummarize-every", 50, "re-emit the running summary after this many watch events (0 disables)")
+	flag.StringVar(&emit, "emit", "", "additional output mode: fileinfo (writes one protocol.FileInfo per included entry)")
+	flag.IntVar(&hashers, "hashers", 2, "number of concurrent hashing workers for -emit=fileinfo")
+	flag.StringVar(&failOnStr, "fail-on", string(failOnNone), "exit non-zero when this condition is met: none|errors|any-ignored")
+	flag.BoolVar(&allFolders, "all-folders", false, "scan every folder in the loaded config instead of a single path (no positional argument)")
+	flag.IntVar(&parallel, "parallel", 1, "number of folders to scan concurrently with -all-folders")
+	flag.StringVar(&fsTypeStr, "fs-type", "", "filesystem type to use: basic|fake|encrypted (default: the folder's configured type, or basic)")
+	flag.StringVar(&fsURI, "fs-uri", "", "fakefs setup URI, used with -fs-type=fake (mirrors Syncthing's fakefs test helper)")
+	flag.StringVar(&snapshotPath, "snapshot", "", "write a snapshot of this scan's included/ignored entries to FILE")
+	flag.StringVar(&diffAgainst, "diff-against", "", "compare this scan against a prior -snapshot FILE and report what changed")
 	flag.Usage = func() {
 		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] <path>\n", os.Args[0])
 		flag.PrintDefaults()
 	}
 	flag.Parse()
 
-	if flag.NArg() != 1 {
-		flag.Usage()
-		os.Exit(exitUsage)
-	}
-
-	inputPath := flag.Arg(0)
 	mode := includeMode(include)
 	if mode != includeFiles && mode != includeAll {
 		fmt.Fprintf(os.Stderr, "invalid --include mode: %s\n", include)
 		os.Exit(exitUsage)
 	}
+	if emit != "" && emit != "fileinfo" {
+		fmt.Fprintf(os.Stderr, "invalid --emit mode: %s\n", emit)
+		os.Exit(exitUsage)
+	}
+	failOn := failOnMode(failOnStr)
+	if failOn != failOnNone && failOn != failOnErrors && failOn != failOnAnyIgnored {
+		fmt.Fprintf(os.Stderr, "invalid --fail-on mode: %s\n", failOnStr)
+		os.Exit(exitUsage)
+	}
+
+	fsType, folderType, err := resolveFilesystemFlags(fsTypeStr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
 
 	cfgWrapper, cfg, cfgLoaded, err := loadConfig(cfgPath)
 	if err != nil {
@@ -230,6 +296,45 @@ func main() {
 		cfgLoaded = false
 	}
 
+	if allFolders {
+		if flag.NArg() != 0 {
+			flag.Usage()
+			os.Exit(exitUsage)
+		}
+		if !cfgLoaded {
+			fmt.Fprintln(os.Stderr, "-all-folders requires a loaded config")
+			os.Exit(exitConfigLoad)
+		}
+		ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer cancel()
+		results, err := runAllFolders(ctx, cfg, folderIDs, batchOptions{
+			mode:          mode,
+			trace:         trace,
+			jsonOutput:    jsonOut,
+			noIgnoreCache: noIgnoreCache,
+			parallel:      parallel,
+		}, os.Stdout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "batch scan failed: %v\n", err)
+			os.Exit(1)
+		}
+		if shouldFailBatch(failOn, results) {
+			os.Exit(exitScanErrors)
+		}
+		return
+	}
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	inputPath := flag.Arg(0)
+	var folderID string
+	if len(folderIDs) > 0 {
+		folderID = folderIDs[0]
+	}
+
 	folderCfg, usingConfig, err := selectFolderConfig(cfgLoaded, cfg, inputPath, folderID)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
@@ -248,6 +353,7 @@ func main() {
 		runCfg.filesystemType = folderCfg.FilesystemType
 		runCfg.caseSensitiveFS = folderCfg.CaseSensitiveFS
 		runCfg.junctionsAsDirs = folderCfg.JunctionsAsDirs
+		runCfg.folderType = folderCfg.Type
 		runCfg.configWasLoaded = cfgLoaded
 		runCfg.configFilePath = cfgWrapper.ConfigPath()
 	} else {
@@ -258,22 +364,109 @@ func main() {
 		fmt.Fprintln(os.Stderr, "warning: no matching config folder; using defaults (results may differ from Syncthing)")
 	}
 
+	if fsTypeStr != "" {
+		runCfg.filesystemType = fsType
+		runCfg.folderType = folderType
+		runCfg.fsURI = fsURI
+	}
+
 	ffs := runCfgFilesystem(folderCfg, runCfg)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	out := newOutputter(os.Stdout, runCfg.trace, runCfg.jsonOutput)
+
+	if runCfg.folderType == config.FolderTypeReceiveEncrypted {
+		// There is no plaintext-side ignore matcher to run these blob names
+		// through: Syncthing derives that per-folder decryption from model
+		// package internals that aren't exposed as a public API. Rather than
+		// match ignore patterns against meaningless ciphertext names, this
+		// mode previews the raw on-disk storage layout only.
+		fmt.Fprintln(os.Stderr, "note: -fs-type=encrypted previews the raw ciphertext blob names on disk; no ignore matcher is applied since plaintext names can't be recovered here")
+		included, scanErrs, err := listEncryptedBlobs(ctx, ffs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "scan failed: %v\n", err)
+			os.Exit(1)
+		}
+		out.emitSummary(included, nil, scanErrs)
+		if (failOn == failOnErrors || failOn == failOnAnyIgnored) && len(scanErrs) > 0 {
+			os.Exit(exitScanErrors)
+		}
+		return
+	}
+
 	matcher := newIgnoreMatcher(ffs, runCfg.ignoreCache)
+	var scanErrs []scanError
 	if err := matcher.Load(".stignore"); err != nil && !fs.IsNotExist(err) {
 		fmt.Fprintf(os.Stderr, "warning: failed to load .stignore: %v\n", err)
+		scanErrs = append(scanErrs, newScanError("stignore", ".stignore", err, true))
 	}
 
-	ctx := context.Background()
-	out := newOutputter(os.Stdout, runCfg.trace, runCfg.jsonOutput)
-
-	included, ignored, err := walkTrace(ctx, ffs, matcher, runCfg, out)
+	included, ignored, walkErrs, err := walkTrace(ctx, ffs, matcher, runCfg, out)
+	scanErrs = append(scanErrs, walkErrs...)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "scan failed: %v\n", err)
 		os.Exit(1)
 	}
 
-	out.emitSummary(included, ignored)
+	out.emitSummary(included, ignored, scanErrs)
+
+	currEntries := buildSnapshotEntries(ffs, included, ignored)
+	if snapshotPath != "" {
+		header := snapshotHeader{
+			FolderID:      runCfg.folderID,
+			Root:          runCfg.folderPath,
+			AutoNormalize: runCfg.autoNormalize,
+			IncludeMode:   runCfg.includeMode,
+		}
+		if err := writeSnapshot(snapshotPath, header, currEntries); err != nil {
+			fmt.Fprintf(os.Stderr, "writing snapshot failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if diffAgainst != "" {
+		prevHeader, prevEntries, err := readSnapshot(diffAgainst)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "reading -diff-against snapshot failed: %v\n", err)
+			os.Exit(1)
+		}
+		currHeader := snapshotHeader{
+			FolderID:      runCfg.folderID,
+			Root:          runCfg.folderPath,
+			AutoNormalize: runCfg.autoNormalize,
+			IncludeMode:   runCfg.includeMode,
+		}
+		if prevHeader != currHeader {
+			fmt.Fprintf(os.Stderr, "warning: -diff-against snapshot %+v does not match this run %+v; diff may not be comparing like for like\n", prevHeader, currHeader)
+		}
+		emitDiff(os.Stdout, diffSnapshots(prevEntries, currEntries), runCfg.jsonOutput)
+	}
+
+	switch failOn {
+	case failOnErrors:
+		if len(scanErrs) > 0 {
+			os.Exit(exitScanErrors)
+		}
+	case failOnAnyIgnored:
+		if len(scanErrs) > 0 || len(ignored) > 0 {
+			os.Exit(exitScanErrors)
+		}
+	}
+
+	if emit == "fileinfo" {
+		if err := emitFileInfos(ctx, ffs, included, runCfg, os.Stdout, hashers); err != nil {
+			fmt.Fprintf(os.Stderr, "emit fileinfo failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	if watch {
+		ws := newWatchState(included, ignored, scanErrs)
+		if err := runWatch(ctx, ffs, matcher, runCfg, out, ws, watchOptions{resummarizeEvery: resummarizeN}); err != nil && !errors.Is(err, context.Canceled) {
+			fmt.Fprintf(os.Stderr, "watch failed: %v\n", err)
+			os.Exit(1)
+		}
+	}
 }
 
 func loadConfig(cfgPath string) (config.Wrapper, config.Configuration, bool, error) {
@@ -369,6 +562,8 @@ func buildRunConfigFromFolder(cfg config.Configuration, folder config.FolderConf
 		scanOwnership:    folder.SendOwnership || folder.SyncOwnership,
 		scanXattrs:       folder.SendXattrs || folder.SyncXattrs,
 		xattrFilter:      folder.XattrFilter,
+		blockSize:        folder.BlockSize(),
+		weakHashPct:      folder.WeakHashThresholdPct,
 		filesystemType:   folder.FilesystemType,
 		caseSensitiveFS:  folder.CaseSensitiveFS,
 		junctionsAsDirs:  folder.JunctionsAsDirs,
@@ -392,6 +587,8 @@ func buildRunConfigAdHoc(inputPath string, mode includeMode, trace, jsonOut, noI
 		scanOwnership:    cfg.Defaults.Folder.SendOwnership || cfg.Defaults.Folder.SyncOwnership,
 		scanXattrs:       cfg.Defaults.Folder.SendXattrs || cfg.Defaults.Folder.SyncXattrs,
 		xattrFilter:      cfg.Defaults.Folder.XattrFilter,
+		blockSize:        cfg.Defaults.Folder.BlockSize(),
+		weakHashPct:      cfg.Defaults.Folder.WeakHashThresholdPct,
 		filesystemType:   cfg.Defaults.Folder.FilesystemType,
 		caseSensitiveFS:  cfg.Defaults.Folder.CaseSensitiveFS,
 		junctionsAsDirs:  cfg.Defaults.Folder.JunctionsAsDirs,
@@ -401,14 +598,17 @@ func buildRunConfigAdHoc(inputPath string, mode includeMode, trace, jsonOut, noI
 
 func runCfgFilesystem(folder config.FolderConfiguration, rc runConfig) fs.Filesystem {
 	if folder.Path == "" {
-		folder = config.FolderConfiguration{
-			Path:            rc.folderPath,
-			FilesystemType:  rc.filesystemType,
-			CaseSensitiveFS: rc.caseSensitiveFS,
-			JunctionsAsDirs: rc.junctionsAsDirs,
-		}
+		folder.CaseSensitiveFS = rc.caseSensitiveFS
+		folder.JunctionsAsDirs = rc.junctionsAsDirs
 	}
+	folder.FilesystemType = rc.filesystemType
+	folder.Type = rc.folderType
 	folder.Path = rc.folderPath
+	if rc.filesystemType == config.FilesystemTypeFake && rc.fsURI != "" {
+		// fakefs encodes its whole setup (size, error injection, seed...)
+		// in the "path", same as Syncthing's own fakefs-backed tests.
+		folder.Path = rc.fsURI
+	}
 	return folder.Filesystem()
 }
 
@@ -419,9 +619,10 @@ func newIgnoreMatcher(ffs fs.Filesystem, cache bool) *ignore.Matcher {
 	return ignore.New(ffs)
 }
 
-func walkTrace(ctx context.Context, ffs fs.Filesystem, matcher *ignore.Matcher, rc runConfig, out *outputter) ([]itemEntry, []itemEntry, error) {
+func walkTrace(ctx context.Context, ffs fs.Filesystem, matcher *ignore.Matcher, rc runConfig, out *outputter) ([]itemEntry, []itemEntry, []scanError, error) {
 	var included []itemEntry
 	var ignored []itemEntry
+	var scanErrs []scanError
 
 	now := time.Now()
 	ignoredParent := ""
@@ -448,7 +649,7 @@ func walkTrace(ctx context.Context, ffs fs.Filesystem, matcher *ignore.Matcher,
 
 		if !utf8.ValidString(path) {
 			out.emit(traceEvent{Event: "error", Path: path, Message: "invalid UTF-8"})
-			ignored = append(ignored, itemEntry{Path: path, Reason: "invalid-utf8"})
+			scanErrs = append(scanErrs, newScanError("utf8", path, errInvalidUTF8, false))
 			return skip
 		}
 
@@ -512,7 +713,7 @@ func walkTrace(ctx context.Context, ffs fs.Filesystem, matcher *ignore.Matcher,
 		if err != nil {
 			if !fs.IsNotExist(err) {
 				out.emit(traceEvent{Event: "error", Path: nonNormPath, Message: err.Error()})
-				ignored = append(ignored, itemEntry{Path: nonNormPath, Reason: "error"})
+				scanErrs = append(scanErrs, newScanError("walk", nonNormPath, err, true))
 			}
 			return skip
 		}
@@ -539,7 +740,7 @@ func walkTrace(ctx context.Context, ffs fs.Filesystem, matcher *ignore.Matcher,
 			info, err = ffs.Lstat(actualPath)
 			if err != nil {
 				out.emit(traceEvent{Event: "error", Path: actualPath, Message: err.Error()})
-				ignored = append(ignored, itemEntry{Path: actualPath, Reason: "error"})
+				scanErrs = append(scanErrs, newScanError("lstat", actualPath, err, false))
 				return skip
 			}
 			handleInclude(actualPath, info, rc, out, &included, &ignored)
@@ -549,9 +750,9 @@ func walkTrace(ctx context.Context, ffs fs.Filesystem, matcher *ignore.Matcher,
 	}
 
 	if err := ffs.Walk(".", walkFn); err != nil && !errors.Is(err, fs.SkipDir) {
-		return included, ignored, err
+		return included, ignored, scanErrs, err
 	}
-	return included, ignored, nil
+	return included, ignored, scanErrs, nil
 }
 
 func handleInclude(path string, info fs.FileInfo, rc runConfig, out *outputter, included *[]itemEntry, ignored *[]itemEntry) {
@@ -0,0 +1,21 @@
+//go:build !windows
+
+package main
+
+import (
+	"syscall"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func ownershipUnixData(info fs.FileInfo) *protocol.UnixData {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	return &protocol.UnixData{
+		UID: int(stat.Uid),
+		GID: int(stat.Gid),
+	}
+}
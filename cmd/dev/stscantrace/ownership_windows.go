@@ -0,0 +1,12 @@
+//go:build windows
+
+package main
+
+import (
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/protocol"
+)
+
+func ownershipUnixData(info fs.FileInfo) *protocol.UnixData {
+	return nil
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/syncthing/syncthing/lib/fs"
+)
+
+// scanErrorCategory groups scanErrors into the handful of failure classes
+// CI pipelines actually want to gate on, mirroring how Syncthing's own
+// scanner buckets FolderErrors.
+type scanErrorCategory string
+
+const (
+	categoryPermission  scanErrorCategory = "permission-denied"
+	categorySymlinkLoop scanErrorCategory = "symlink-loop"
+	categoryInvalidUTF8 scanErrorCategory = "invalid-utf8"
+	categoryStatFailure scanErrorCategory = "stat-failure"
+	categoryStignore    scanErrorCategory = "stignore-parse"
+	categoryOther       scanErrorCategory = "other"
+)
+
+// scanError is a first-class record of a failure encountered during a scan
+// or watch, as opposed to an item that was deliberately ignored.
+type scanError struct {
+	Path      string            `json:"path"`
+	Op        string            `json:"op"`
+	Err       string            `json:"error"`
+	Category  scanErrorCategory `json:"category"`
+	Continued bool              `json:"continued"`
+}
+
+type failOnMode string
+
+const (
+	failOnNone       failOnMode = "none"
+	failOnErrors     failOnMode = "errors"
+	failOnAnyIgnored failOnMode = "any-ignored"
+)
+
+const exitScanErrors = 5
+
+var errInvalidUTF8 = errors.New("invalid UTF-8 path")
+
+func categorizeError(op string, err error) scanErrorCategory {
+	switch {
+	case op == "utf8":
+		return categoryInvalidUTF8
+	case op == "stignore":
+		return categoryStignore
+	case fs.IsPermission(err):
+		return categoryPermission
+	case isSymlinkLoop(err):
+		return categorySymlinkLoop
+	case op == "lstat" || op == "stat":
+		return categoryStatFailure
+	default:
+		return categoryOther
+	}
+}
+
+func isSymlinkLoop(err error) bool {
+	if err == nil {
+		return false
+	}
+	var linkErr *linkLoopError
+	if errors.As(err, &linkErr) {
+		return true
+	}
+	return strings.Contains(err.Error(), "too many levels of symbolic links")
+}
+
+// linkLoopError lets tests construct a synthetic symlink-loop error without
+// depending on a particular OS's errno spelling.
+type linkLoopError struct {
+	Path string
+}
+
+func (e *linkLoopError) Error() string {
+	return "symlink loop at " + e.Path
+}
+
+func newScanError(op, path string, err error, continued bool) scanError {
+	return scanError{
+		Path:      path,
+		Op:        op,
+		Err:       err.Error(),
+		Category:  categorizeError(op, err),
+		Continued: continued,
+	}
+}
+
+func printErrorsSummary(w io.Writer, errs []scanError) {
+	fmt.Fprintf(w, "Errors (%d)\n", len(errs))
+	for _, e := range errs {
+		fmt.Fprintf(w, "- %s [%s] %s: %s\n", e.Path, e.Op, e.Category, e.Err)
+	}
+}
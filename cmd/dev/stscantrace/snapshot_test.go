@@ -0,0 +1,43 @@
+package main
+
+import "testing"
+
+func TestDiffSnapshots(t *testing.T) {
+	prev := []snapshotEntry{
+		{Path: "a.txt", Size: 10, ModS: 100},
+		{Path: "b.txt", Size: 20, ModS: 200},
+		{Path: "c.txt", Ignored: true},
+		{Path: "link", Kind: "symlink", Target: "old-target"},
+		{Path: "z.txt", Size: 1, ModS: 1},
+	}
+	curr := []snapshotEntry{
+		{Path: "a.txt", Size: 10, ModS: 100},
+		{Path: "b.txt", Size: 99, ModS: 200},
+		{Path: "c.txt", Ignored: false},
+		{Path: "link", Kind: "symlink", Target: "new-target"},
+		{Path: "new.txt", Size: 5, ModS: 5},
+	}
+
+	diffs := diffSnapshots(prev, curr)
+
+	want := map[string]string{
+		"b.txt":   "modified",
+		"c.txt":   "newly-included",
+		"link":    "modified",
+		"new.txt": "added",
+		"z.txt":   "removed",
+	}
+	if len(diffs) != len(want) {
+		t.Fatalf("diffSnapshots: got %d diffs, want %d: %+v", len(diffs), len(want), diffs)
+	}
+	for _, d := range diffs {
+		event, ok := want[d.Path]
+		if !ok {
+			t.Errorf("unexpected diff for path %q: %+v", d.Path, d)
+			continue
+		}
+		if d.Event != event {
+			t.Errorf("path %q: got event %q, want %q", d.Path, d.Event, event)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/syncthing/syncthing/lib/fs"
+	"github.com/syncthing/syncthing/lib/ignore"
+)
+
+// watchState tracks the running include/ignore sets so the JSON stream can
+// keep emitting an up-to-date summary as events arrive, without re-walking
+// the whole tree on every change.
+type watchState struct {
+	included map[string]itemEntry
+	ignored  map[string]itemEntry
+	errs     []scanError
+}
+
+func newWatchState(included, ignored []itemEntry, errs []scanError) *watchState {
+	ws := &watchState{
+		included: make(map[string]itemEntry, len(included)),
+		ignored:  make(map[string]itemEntry, len(ignored)),
+		errs:     append([]scanError(nil), errs...),
+	}
+	for _, it := range included {
+		ws.included[it.Path] = it
+	}
+	for _, it := range ignored {
+		ws.ignored[it.Path] = it
+	}
+	return ws
+}
+
+func (ws *watchState) snapshot() ([]itemEntry, []itemEntry) {
+	included := make([]itemEntry, 0, len(ws.included))
+	for _, it := range ws.included {
+		included = append(included, it)
+	}
+	ignored := make([]itemEntry, 0, len(ws.ignored))
+	for _, it := range ws.ignored {
+		ignored = append(ignored, it)
+	}
+	return included, ignored
+}
+
+func (ws *watchState) remove(path string) {
+	delete(ws.included, path)
+	delete(ws.ignored, path)
+}
+
+func (ws *watchState) classify(path string, info fs.FileInfo, rc runConfig, out *outputter) {
+	ws.remove(path)
+
+	normPath := normalizePath(path)
+	if normPath != path && !rc.autoNormalize {
+		ws.ignored[path] = itemEntry{Path: path, Reason: "normalization-disabled"}
+		out.emit(traceEvent{Event: "ignore", Path: path, Reason: "normalization-disabled"})
+		return
+	}
+
+	match, pat := rc.watchMatcher.MatchWithPattern(normPath)
+	if match.IsIgnored() {
+		ws.ignored[path] = itemEntry{Path: path, Reason: formatPatternReason(pat)}
+		out.emit(traceEvent{Event: "ignore", Path: path, Reason: "pattern", Pattern: pat})
+		return
+	}
+
+	if info == nil || !info.IsRegular() {
+		return
+	}
+	ws.included[path] = itemEntry{Path: path, Kind: "file"}
+	out.emit(traceEvent{Event: "include", Path: path, Kind: "file"})
+}
+
+// watchOptions bundles the flags controlling watch-mode behavior so they
+// don't need to be threaded through runConfig, which is built before the
+// watch flag is known to apply.
+type watchOptions struct {
+	resummarizeEvery int
+}
+
+// runWatch streams filesystem events through the same ignore matcher used
+// by the initial walk and keeps emitting traceEvents plus periodic summary
+// snapshots until ctx is canceled. Passing matcher straight to
+// fs.Filesystem.Watch (it implements fs.Matcher) gets Syncthing's own
+// SkipIgnoredDirs optimization for free: the backend never generates events
+// for whole ignored subtrees the matcher can skip.
+func runWatch(ctx context.Context, ffs fs.Filesystem, matcher *ignore.Matcher, rc runConfig, out *outputter, ws *watchState, opts watchOptions) error {
+	rc.watchMatcher = matcher
+
+	eventChan, errChan, err := ffs.Watch(".", matcher, ctx, rc.ignorePerms)
+	if err != nil {
+		return err
+	}
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	window := rc.modTimeWindow
+	if window <= 0 {
+		window = time.Second
+	}
+
+	type pending struct {
+		kind string
+		at   time.Time
+	}
+	coalesced := make(map[string]pending)
+	flush := time.NewTicker(window)
+	defer flush.Stop()
+
+	eventsSinceSummary := 0
+
+	emitSummary := func() {
+		included, ignored := ws.snapshot()
+		out.emitSummary(included, ignored, ws.errs)
+		eventsSinceSummary = 0
+	}
+
+	// reloadStignore mirrors Syncthing's own folder scanner: a change to the
+	// ignore file itself must refresh the matcher in place so subsequent
+	// change/remove events are classified against the new patterns, rather
+	// than the ones captured when the watch started.
+	reloadStignore := func(path string) {
+		if err := matcher.Load(".stignore"); err != nil && !fs.IsNotExist(err) {
+			out.emit(traceEvent{Event: "error", Path: path, Message: "reload .stignore: " + err.Error()})
+			ws.errs = append(ws.errs, newScanError("stignore", path, err, true))
+			return
+		}
+		out.emit(traceEvent{Event: "reload", Path: path, Reason: "stignore"})
+	}
+
+	settle := func(path string, p pending) {
+		delete(coalesced, path)
+		if p.kind == "remove" {
+			ws.remove(path)
+			out.emit(traceEvent{Event: "remove", Path: path})
+			eventsSinceSummary++
+			return
+		}
+		info, err := ffs.Lstat(path)
+		if err != nil {
+			if fs.IsNotExist(err) {
+				ws.remove(path)
+				out.emit(traceEvent{Event: "remove", Path: path})
+			} else {
+				out.emit(traceEvent{Event: "error", Path: path, Message: err.Error()})
+				ws.errs = append(ws.errs, newScanError("watch-lstat", path, err, true))
+			}
+			eventsSinceSummary++
+			return
+		}
+		if normalizePath(path) == ".stignore" {
+			reloadStignore(path)
+		}
+		ws.classify(path, info, rc, out)
+		out.emit(traceEvent{Event: "change", Path: path})
+		eventsSinceSummary++
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case err, ok := <-errChan:
+			if !ok {
+				errChan = nil
+				continue
+			}
+			if err != nil {
+				out.emit(traceEvent{Event: "error", Message: err.Error()})
+				ws.errs = append(ws.errs, newScanError("watch", "", err, true))
+			}
+
+		case ev, ok := <-eventChan:
+			if !ok {
+				eventChan = nil
+				continue
+			}
+			kind := "change"
+			if ev.Type == fs.Remove {
+				kind = "remove"
+			}
+			coalesced[ev.Name] = pending{kind: kind, at: time.Now()}
+
+		case <-flush.C:
+			cutoff := time.Now().Add(-window)
+			for path, p := range coalesced {
+				if p.at.Before(cutoff) || p.at.Equal(cutoff) {
+					settle(path, p)
+				}
+			}
+			if opts.resummarizeEvery > 0 && eventsSinceSummary >= opts.resummarizeEvery {
+				emitSummary()
+			}
+
+		case <-hup:
+			emitSummary()
+		}
+	}
+}